@@ -0,0 +1,123 @@
+/*
+Copyright 2014 The go-marathon Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// callbackTransport is the built-in EventTransport that registers a HTTP
+// callback URL with Marathon's subscription API and receives events as POST
+// requests against it.
+type callbackTransport struct {
+	client *Client
+	events chan rawEvent
+}
+
+func newCallbackTransport() *callbackTransport {
+	return &callbackTransport{events: make(chan rawEvent, 64)}
+}
+
+func (t *callbackTransport) Register(ctx context.Context, client *Client) error {
+	t.client = client
+	marathon := client.marathon
+
+	if marathon.eventsHTTP == nil {
+		ipAddress, err := getInterfaceAddress(marathon.config.EventsInterface)
+		if err != nil {
+			return fmt.Errorf("Unable to get the ip address from the interface: %s, error: %s",
+				marathon.config.EventsInterface, err)
+		}
+
+		// step: set the ip address
+		marathon.ipAddress = ipAddress
+		binding := fmt.Sprintf("%s:%d", ipAddress, marathon.config.EventsPort)
+		// step: register the handler
+		http.HandleFunc(defaultEventsURL, t.handleCallbackEvent)
+		// step: create the http server
+		marathon.eventsHTTP = &http.Server{
+			Addr:           binding,
+			Handler:        nil,
+			ReadTimeout:    10 * time.Second,
+			WriteTimeout:   10 * time.Second,
+			MaxHeaderBytes: 1 << 20,
+		}
+
+		// @todo need to add a timeout value here
+		listener, err := net.Listen("tcp", binding)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			backoff := defaultSSEBackoff
+			for {
+				err := marathon.eventsHTTP.Serve(listener)
+				if err == http.ErrServerClosed || ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					client.DebugLog("callbackTransport: events server exited: %s", err)
+					time.Sleep(backoff)
+					backoff = nextSSEBackoff(backoff, defaultSSEBackoff, defaultSSEMaxBackoff)
+				}
+			}
+		}()
+	}
+
+	// step: get the callback url
+	callback := client.SubscriptionURL()
+
+	// step: check if the callback is registered
+	found, err := client.HasSubscription(callback)
+	if err != nil {
+		return err
+	}
+	if !found {
+		// step: we need to register ourselves
+		if err := client.Subscribe(callback); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *callbackTransport) Events() <-chan rawEvent {
+	return t.events
+}
+
+func (t *callbackTransport) Close() error {
+	close(t.events)
+	return nil
+}
+
+func (t *callbackTransport) handleCallbackEvent(writer http.ResponseWriter, request *http.Request) {
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		// TODO should this return a 500?
+		t.client.DebugLog("handleCallbackEvent(): failed to read request body, error: %s", err)
+		return
+	}
+
+	t.events <- rawEvent(body)
+}
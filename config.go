@@ -0,0 +1,113 @@
+/*
+Copyright 2014 The go-marathon Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// EventsTransportType describes the mechanism used to receive events from Marathon
+type EventsTransportType int
+
+const (
+	// EventsTransportCallback uses a HTTP callback registered with Marathon's subscription API
+	EventsTransportCallback EventsTransportType = iota
+	// EventsTransportSSE uses the /v2/events SSE stream
+	EventsTransportSSE
+)
+
+// Config is the configuration used to create a new Marathon client
+type Config struct {
+	// URL is the url for marathon
+	URL string
+	// HTTPClient is the HTTP client used for regular API calls
+	HTTPClient *http.Client
+	// HTTPSSEClient is the HTTP client used for the SSE event stream
+	HTTPSSEClient *http.Client
+	// EventsTransport is the transport used to receive events, defaults to EventsTransportCallback
+	EventsTransport EventsTransportType
+	// CallbackURL overrides the auto-detected callback url used to register for events
+	CallbackURL string
+	// EventsInterface is the network interface to derive the callback ip address from
+	EventsInterface string
+	// EventsPort is the port the callback HTTP server listens on
+	EventsPort int
+	// SSEBackoff is the initial delay used by the decorrelated-jitter backoff
+	// between SSE reconnect attempts. Defaults to 500ms.
+	SSEBackoff time.Duration
+	// SSEMaxBackoff caps the delay between SSE reconnect attempts. Defaults to 60s.
+	SSEMaxBackoff time.Duration
+	// SSEResumeFromLastEventID, when true, makes the client send the id of the
+	// last successfully processed SSE event as the Last-Event-ID header on
+	// reconnect, so Marathon can resume the stream instead of replaying it
+	// from scratch.
+	SSEResumeFromLastEventID bool
+	// OnSSEReconnect, if set, is invoked whenever the SSE subscription
+	// reconnects, before the new connection attempt is made. It is useful for
+	// instrumenting reconnect storms against a flapping cluster.
+	OnSSEReconnect func(attempt int, lastID string, err error)
+	// EventTransports lets callers plug in their own EventTransport
+	// implementations, or override the built-in ones, keyed by the
+	// EventsTransportType they should handle.
+	EventTransports map[EventsTransportType]EventTransport
+	// Context, if set, governs the lifetime of the client's event
+	// subscriptions: cancelling it unblocks in-flight requests and stops the
+	// SSE and WebSocket transports' background goroutines. It does not shut
+	// down the callback server, unsubscribe the callback or close listener
+	// channels; Close() does those. Defaults to context.Background() via
+	// ClientWithContext.
+	Context context.Context
+	// MetricsHook, if set, is invoked for every instrumentation point the
+	// events subsystem exposes: per-event-type counts, SSE reconnects,
+	// current listener count and dropped-event counts. It is intentionally a
+	// single free-form (name, value) callback rather than a dependency on a
+	// specific metrics library, so callers can adapt it to Prometheus,
+	// StatsD, or whatever they already use.
+	MetricsHook func(name string, value float64)
+	// LogOutput is an optional writer used for debug logging
+	LogOutput interface {
+		Write(p []byte) (n int, err error)
+	}
+}
+
+// defaultSSEBackoff is the initial delay between SSE reconnect attempts
+const defaultSSEBackoff = 500 * time.Millisecond
+
+// defaultSSEMaxBackoff caps the delay between SSE reconnect attempts
+const defaultSSEMaxBackoff = 60 * time.Second
+
+// sseHealthyThreshold is how long a stream must stay up before a subsequent
+// disconnect resets the backoff back to SSEBackoff rather than continuing to
+// grow it.
+const sseHealthyThreshold = 30 * time.Second
+
+// NewDefaultConfig returns a default configuration for the client
+func NewDefaultConfig() Config {
+	return Config{
+		EventsTransport: EventsTransportCallback,
+		EventsInterface: "eth0",
+		EventsPort:      10001,
+		SSEBackoff:      defaultSSEBackoff,
+		SSEMaxBackoff:   defaultSSEMaxBackoff,
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		HTTPSSEClient: &http.Client{},
+	}
+}
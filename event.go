@@ -0,0 +1,262 @@
+/*
+Copyright 2014 The go-marathon Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// EventIDApplications is fired when an application changes
+	EventIDApplications = 1 << iota
+	// EventIDAPIRequest is fired on an API request
+	EventIDAPIRequest
+	// EventIDStatusUpdate is fired when a task changes status
+	EventIDStatusUpdate
+	// EventIDFrameworkMessage is fired when a framework message is received
+	EventIDFrameworkMessage
+	// EventIDSubscription is fired when a callback subscription is registered
+	EventIDSubscription
+	// EventIDUnsubscribed is fired when a callback subscription is removed
+	EventIDUnsubscribed
+	// EventIDAddHealthCheck is fired when a health check is added
+	EventIDAddHealthCheck
+	// EventIDRemoveHealthCheck is fired when a health check is removed
+	EventIDRemoveHealthCheck
+	// EventIDFailedHealthCheck is fired when a health check fails
+	EventIDFailedHealthCheck
+	// EventIDChangedHealthCheck is fired when a health check status changes
+	EventIDChangedHealthCheck
+	// EventIDGroupChangeSuccess is fired when a group change succeeds
+	EventIDGroupChangeSuccess
+	// EventIDGroupChangeFailed is fired when a group change fails
+	EventIDGroupChangeFailed
+	// EventIDDeploymentSuccess is fired when a deployment succeeds
+	EventIDDeploymentSuccess
+	// EventIDDeploymentFailed is fired when a deployment fails
+	EventIDDeploymentFailed
+	// EventIDDeploymentInfo is fired with deployment information
+	EventIDDeploymentInfo
+	// EventIDDeploymentStepSuccess is fired when a deployment step succeeds
+	EventIDDeploymentStepSuccess
+	// EventIDDeploymentStepFailed is fired when a deployment step fails
+	EventIDDeploymentStepFailed
+	// EventIDUnknown is reserved for event types we don't recognize; GetEvent
+	// returns an error for those, so no decoded event carries this id
+	EventIDUnknown
+
+	// EventsAll is a filter matching every known event
+	EventsAll = EventIDApplications | EventIDAPIRequest | EventIDStatusUpdate |
+		EventIDFrameworkMessage | EventIDSubscription | EventIDUnsubscribed |
+		EventIDAddHealthCheck | EventIDRemoveHealthCheck | EventIDFailedHealthCheck |
+		EventIDChangedHealthCheck | EventIDGroupChangeSuccess | EventIDGroupChangeFailed |
+		EventIDDeploymentSuccess | EventIDDeploymentFailed | EventIDDeploymentInfo |
+		EventIDDeploymentStepSuccess | EventIDDeploymentStepFailed
+)
+
+// EventType is used to decode the top-level "eventType" field common to every
+// Marathon event before we know which concrete struct to decode the rest of
+// the payload into.
+type EventType struct {
+	EventType string `json:"eventType"`
+}
+
+// Event is a wrapper for an event received from Marathon, either via the
+// callback facility or the SSE stream.
+type Event struct {
+	// ID is the internal bitmask identifier for this event's type
+	ID int
+	// Event holds the decoded, concrete event payload, e.g. *EventStatusUpdate
+	Event interface{}
+}
+
+// EventAPIRequest fires whenever Marathon receives an API request
+type EventAPIRequest struct {
+	ClientIP string `json:"clientIp"`
+	URI      string `json:"uri"`
+}
+
+// EventStatusUpdate fires whenever a task changes status
+type EventStatusUpdate struct {
+	ClientIP   string   `json:"clientIp"`
+	TaskStatus string   `json:"taskStatus"`
+	AppID      string   `json:"appId"`
+	TaskID     string   `json:"taskId"`
+	Host       string   `json:"host"`
+	Ports      []int    `json:"ports"`
+	Version    string   `json:"version"`
+	SlaveID    string   `json:"slaveId"`
+}
+
+// EventFrameworkMessage fires when a framework message is received
+type EventFrameworkMessage struct {
+	SlaveID   string `json:"slaveId"`
+	ExecutorID string `json:"executorId"`
+	Message   string `json:"message"`
+}
+
+// EventSubscription fires when a callback subscription is registered
+type EventSubscription struct {
+	ClientIP    string `json:"clientIp"`
+	CallbackURL string `json:"callbackUrl"`
+}
+
+// EventUnsubscription fires when a callback subscription is removed
+type EventUnsubscription struct {
+	ClientIP    string `json:"clientIp"`
+	CallbackURL string `json:"callbackUrl"`
+}
+
+// EventHealthCheckAdded fires when a health check is added to an application
+type EventHealthCheckAdded struct {
+	AppID       string      `json:"appId"`
+	HealthCheck interface{} `json:"healthCheck"`
+}
+
+// EventHealthCheckRemoved fires when a health check is removed from an application
+type EventHealthCheckRemoved struct {
+	AppID       string      `json:"appId"`
+	HealthCheck interface{} `json:"healthCheck"`
+}
+
+// EventHealthCheckFailed fires when a task fails its health check
+type EventHealthCheckFailed struct {
+	AppID  string `json:"appId"`
+	TaskID string `json:"taskId"`
+	Version string `json:"version"`
+}
+
+// EventHealthCheckChanged fires when a task's health check status changes
+type EventHealthCheckChanged struct {
+	AppID  string `json:"appId"`
+	TaskID string `json:"taskId"`
+	Alive  bool   `json:"alive"`
+}
+
+// EventGroupChangeSuccess fires when a group change succeeds
+type EventGroupChangeSuccess struct {
+	GroupID string `json:"groupId"`
+	Version string `json:"version"`
+}
+
+// EventGroupChangeFailed fires when a group change fails
+type EventGroupChangeFailed struct {
+	GroupID string `json:"groupId"`
+	Version string `json:"version"`
+	Reason  string `json:"reason"`
+}
+
+// EventDeploymentSuccess fires when a deployment succeeds
+type EventDeploymentSuccess struct {
+	ID string `json:"id"`
+}
+
+// EventDeploymentFailed fires when a deployment fails
+type EventDeploymentFailed struct {
+	ID string `json:"id"`
+}
+
+// EventDeploymentInfo carries progress information about an ongoing deployment
+type EventDeploymentInfo struct {
+	ID   string `json:"id"`
+}
+
+// EventDeploymentStepSuccess fires when a single deployment step succeeds
+type EventDeploymentStepSuccess struct {
+	ID string `json:"id"`
+}
+
+// EventDeploymentStepFailed fires when a single deployment step fails
+type EventDeploymentStepFailed struct {
+	ID string `json:"id"`
+}
+
+// eventFactory returns a freshly allocated, concrete struct to decode an
+// event's payload into for the given wire "eventType" name, along with the
+// internal bitmask id it corresponds to.
+var eventFactory = map[string]struct {
+	id      int
+	newEvent func() interface{}
+}{
+	"api_post_event":              {EventIDAPIRequest, func() interface{} { return new(EventAPIRequest) }},
+	"status_update_event":         {EventIDStatusUpdate, func() interface{} { return new(EventStatusUpdate) }},
+	"framework_message_event":     {EventIDFrameworkMessage, func() interface{} { return new(EventFrameworkMessage) }},
+	"subscribe_event":             {EventIDSubscription, func() interface{} { return new(EventSubscription) }},
+	"unsubscribe_event":           {EventIDUnsubscribed, func() interface{} { return new(EventUnsubscription) }},
+	"add_health_check_event":      {EventIDAddHealthCheck, func() interface{} { return new(EventHealthCheckAdded) }},
+	"remove_health_check_event":   {EventIDRemoveHealthCheck, func() interface{} { return new(EventHealthCheckRemoved) }},
+	"failed_health_check_event":   {EventIDFailedHealthCheck, func() interface{} { return new(EventHealthCheckFailed) }},
+	"health_status_changed_event": {EventIDChangedHealthCheck, func() interface{} { return new(EventHealthCheckChanged) }},
+	"group_change_success":        {EventIDGroupChangeSuccess, func() interface{} { return new(EventGroupChangeSuccess) }},
+	"group_change_failed":         {EventIDGroupChangeFailed, func() interface{} { return new(EventGroupChangeFailed) }},
+	"deployment_success":          {EventIDDeploymentSuccess, func() interface{} { return new(EventDeploymentSuccess) }},
+	"deployment_failed":           {EventIDDeploymentFailed, func() interface{} { return new(EventDeploymentFailed) }},
+	"deployment_info":             {EventIDDeploymentInfo, func() interface{} { return new(EventDeploymentInfo) }},
+	"deployment_step_success":     {EventIDDeploymentStepSuccess, func() interface{} { return new(EventDeploymentStepSuccess) }},
+	"deployment_step_failed":      {EventIDDeploymentStepFailed, func() interface{} { return new(EventDeploymentStepFailed) }},
+}
+
+// GetEvent returns an empty Event for the given Marathon event type name, so
+// that the caller can decode the remainder of the payload into Event.Event.
+func GetEvent(name string) (*Event, error) {
+	entry, found := eventFactory[name]
+	if !found {
+		return nil, fmt.Errorf("the event type: %s is not supported", name)
+	}
+
+	return &Event{ID: entry.id, Event: entry.newEvent()}, nil
+}
+
+// EventsChannel is a channel used to receive events on
+type EventsChannel chan *Event
+
+// defaultListenerQueueSize is the number of events buffered per listener
+// before the drop policy configured via ListenerOptions kicks in.
+const defaultListenerQueueSize = 64
+
+// ListenerOptions configures the bounded internal queue AddEventsListener
+// uses to decouple event dispatch from a potentially slow consumer.
+type ListenerOptions struct {
+	// QueueSize is the number of events buffered for this listener before the
+	// drop policy kicks in. Defaults to defaultListenerQueueSize.
+	QueueSize int
+	// DropNewest, if true, drops the incoming event when the queue is full
+	// instead of the default policy of dropping the oldest queued event to
+	// make room for it.
+	DropNewest bool
+}
+
+// Stats reports per-listener bookkeeping exposed via ListenerStats.
+type Stats struct {
+	// DroppedEvents is the number of events dropped because this listener's
+	// queue was full, i.e. it wasn't draining EventsChannel fast enough.
+	DroppedEvents uint64
+}
+
+// EventsChannelContext holds per-listener state for the bitmask-filtered,
+// callback-style event API. A single dispatcher goroutine drains queue into
+// the listener's EventsChannel, so a slow consumer only ever blocks that one
+// goroutine instead of spawning one per undelivered event.
+type EventsChannelContext struct {
+	filter     int
+	done       chan struct{}
+	completion *sync.WaitGroup
+	queue      chan *Event
+	dropNewest bool
+	dropped    *uint64
+}
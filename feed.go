@@ -0,0 +1,174 @@
+/*
+Copyright 2014 The go-marathon Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// feedSubQueueSize is the number of pending events buffered per subscription
+// before the oldest queued event is dropped in favour of the newest one.
+const feedSubQueueSize = 16
+
+// Subscription represents a stream of events delivered by a Feed. The
+// subscriber must read from the channel passed to Subscribe until either the
+// channel is unsubscribed or Err() is read from.
+type Subscription interface {
+	// Err returns a channel that is closed when the subscription ends, and
+	// carries a single slow-consumer error if events had to be dropped.
+	Err() <-chan error
+	// Unsubscribe stops delivery and closes Err()
+	Unsubscribe()
+}
+
+// Feed implements typed, one-to-many event distribution, inspired by
+// go-ethereum's event.Feed. Subscribers get a compile-time-typed channel
+// instead of a type-switched *Event and a bitmask filter. Subscribe checks by
+// reflection only that it is given a sendable channel; a Feed does not bind
+// its subscribers to one element type, and Send delivers a value only to the
+// subscribers whose channel element type it is assignable to.
+type Feed struct {
+	mu   sync.Mutex
+	subs map[*feedSub]struct{}
+}
+
+// NewFeed creates an empty Feed ready to accept subscribers
+func NewFeed() *Feed {
+	return &Feed{subs: make(map[*feedSub]struct{})}
+}
+
+// Subscribe registers channel to receive values sent on the feed. channel
+// must be a chan<- *T (or chan T) for some concrete event type T; Subscribe
+// panics otherwise, since a bad subscriber type is a programming error, not a
+// runtime condition callers should have to check for.
+func (f *Feed) Subscribe(channel interface{}) Subscription {
+	chanVal := reflect.ValueOf(channel)
+	chanType := chanVal.Type()
+	if chanType.Kind() != reflect.Chan || chanType.ChanDir()&reflect.SendDir == 0 {
+		panic(fmt.Sprintf("event: Subscribe argument does not have sendable channel type: %s", chanType))
+	}
+
+	sub := &feedSub{
+		feed:    f,
+		channel: chanVal,
+		queue:   make(chan reflect.Value, feedSubQueueSize),
+		err:     make(chan error, 1),
+		done:    make(chan struct{}),
+	}
+
+	f.mu.Lock()
+	f.subs[sub] = struct{}{}
+	f.mu.Unlock()
+
+	go sub.loop()
+
+	return sub
+}
+
+// Send delivers value, which must be assignable to the element type of a
+// given subscriber's channel, to every current subscriber whose channel
+// matches. It returns the number of subscribers the value was queued for.
+func (f *Feed) Send(value interface{}) int {
+	rvalue := reflect.ValueOf(value)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sent := 0
+	for sub := range f.subs {
+		if !rvalue.Type().AssignableTo(sub.channel.Type().Elem()) {
+			continue
+		}
+		sub.send(rvalue)
+		sent++
+	}
+	return sent
+}
+
+// feedSub is a single subscriber of a Feed. Delivery to the user channel
+// happens on a dedicated goroutine (loop) draining a bounded queue, so a slow
+// consumer only ever blocks its own dispatcher goroutine, never Send.
+type feedSub struct {
+	feed    *Feed
+	channel reflect.Value
+	queue   chan reflect.Value
+	err     chan error
+	done    chan struct{}
+	unsub   sync.Once
+}
+
+func (s *feedSub) loop() {
+	doneCase := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.done)}
+
+	for {
+		select {
+		case v := <-s.queue:
+			// step: race the delivery send against done, so a subscriber that
+			// stops reading channel and then calls Unsubscribe doesn't leave
+			// this goroutine blocked on the send forever
+			sendCase := reflect.SelectCase{Dir: reflect.SelectSend, Chan: s.channel, Send: v}
+			chosen, _, _ := reflect.Select([]reflect.SelectCase{sendCase, doneCase})
+			if chosen == 1 {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// send queues value for delivery without blocking the caller. When the
+// queue is full the oldest pending value is dropped to make room and a
+// slow-consumer error is reported via Err().
+func (s *feedSub) send(value reflect.Value) {
+	select {
+	case s.queue <- value:
+		return
+	default:
+	}
+
+	select {
+	case <-s.queue:
+	default:
+	}
+	select {
+	case s.queue <- value:
+	default:
+	}
+
+	select {
+	case s.err <- fmt.Errorf("event: slow consumer, dropped event"):
+	default:
+	}
+}
+
+func (s *feedSub) Err() <-chan error {
+	return s.err
+}
+
+func (s *feedSub) Unsubscribe() {
+	s.unsub.Do(func() {
+		s.feed.mu.Lock()
+		delete(s.feed.subs, s)
+		s.feed.mu.Unlock()
+
+		close(s.done)
+		close(s.err)
+	})
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2014 The go-marathon Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFeedSendDropsForSlowConsumer asserts that a subscriber which never
+// reads its channel gets an "event: slow consumer, dropped event" error on
+// Err() instead of stalling Feed.Send for every other subscriber.
+func TestFeedSendDropsForSlowConsumer(t *testing.T) {
+	feed := NewFeed()
+
+	channel := make(chan int)
+	sub := feed.Subscribe(channel)
+	defer sub.Unsubscribe()
+
+	done := make(chan struct{})
+	go func() {
+		// one value can be held by the delivery goroutine and feedSubQueueSize
+		// more by the queue, so it takes feedSubQueueSize+2 sends to force a drop
+		for i := 0; i < feedSubQueueSize+2; i++ {
+			feed.Send(i)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Send blocked on a slow consumer instead of dropping")
+	}
+
+	select {
+	case err := <-sub.Err():
+		if err == nil {
+			t.Fatal("expected a slow consumer error, got nil")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a slow consumer error on Err(), got none")
+	}
+}
+
+// TestFeedUnsubscribeUnblocksDelivery asserts that Unsubscribe stops the
+// feedSub delivery goroutine even while it's blocked trying to send to a
+// subscriber that has stopped reading, instead of leaking the goroutine.
+func TestFeedUnsubscribeUnblocksDelivery(t *testing.T) {
+	feed := NewFeed()
+
+	channel := make(chan int)
+	sub := feed.Subscribe(channel)
+
+	// get a value queued and the delivery goroutine blocked trying to send
+	// it, then stop reading channel entirely
+	feed.Send(1)
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		sub.Unsubscribe()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Unsubscribe did not return; the delivery goroutine appears blocked on a send")
+	}
+}
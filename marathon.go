@@ -0,0 +1,299 @@
+/*
+Copyright 2014 The go-marathon Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Marathon is the interface implemented by marathonClient, describing the
+// subset of the client surface touched by the events subsystem
+type Marathon interface {
+	// Subscriptions retrieves a list of registered subscriptions
+	Subscriptions() (*Subscriptions, error)
+	// AddEventsListener adds your self as a listener to events from Marathon
+	AddEventsListener(filter int) (EventsChannel, error)
+	// AddEventsListenerWithOptions is AddEventsListener with control over the
+	// per-listener queue size and drop policy
+	AddEventsListenerWithOptions(filter int, opts ListenerOptions) (EventsChannel, error)
+	// RemoveEventsListener removes the channel from the events listeners
+	RemoveEventsListener(channel EventsChannel)
+	// ListenerStats reports bookkeeping, e.g. dropped events, for the given listener channel
+	ListenerStats(channel EventsChannel) Stats
+	// SubscriptionURL retrieves the subscription callback URL used when registering
+	SubscriptionURL() string
+	// Subscribe adds a URL to Marathon's callback facility
+	Subscribe(callback string) error
+	// Unsubscribe removes a URL from Marathon's callback facility
+	Unsubscribe(callback string) error
+	// HasSubscription checks to see a subscription already exists with Marathon
+	HasSubscription(callback string) (bool, error)
+	// RegisterEventTransport registers a custom EventTransport, overriding the built-in callback/SSE transports
+	RegisterEventTransport(id EventsTransportType, transport EventTransport)
+	// SubscribeStatusUpdates subscribes channel to task status update events
+	SubscribeStatusUpdates(channel chan<- *EventStatusUpdate) Subscription
+	// SubscribeDeploymentSuccess subscribes channel to successful deployment events
+	SubscribeDeploymentSuccess(channel chan<- *EventDeploymentSuccess) Subscription
+	// SubscribeDeploymentFailed subscribes channel to failed deployment events
+	SubscribeDeploymentFailed(channel chan<- *EventDeploymentFailed) Subscription
+	// Close cancels the client's context, shuts down the events callback
+	// server, unsubscribes all callbacks and waits for pending listener
+	// goroutines to finish before returning
+	Close() error
+}
+
+const (
+	marathonAPISubscription = "/v2/eventSubscriptions"
+	marathonAPIEventStream  = "/v2/events"
+	defaultEventsURL        = "/events"
+)
+
+// newRequestError indicates the http.Request for an API call could not be built
+type newRequestError struct {
+	err error
+}
+
+func (e newRequestError) Error() string {
+	return e.err.Error()
+}
+
+// cluster tracks the active Marathon cluster members. markDown removes a
+// member from rotation; reset repopulates it from the original, full member
+// list so the cluster can recover once every member has been tried.
+type cluster struct {
+	sync.RWMutex
+	members []string
+	all     []string
+}
+
+func newCluster(members []string) *cluster {
+	all := append([]string(nil), members...)
+	return &cluster{members: append([]string(nil), all...), all: all}
+}
+
+// activeMember returns the first active cluster member, or false if every
+// member has been marked down.
+func (c *cluster) activeMember() (string, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	if len(c.members) == 0 {
+		return "", false
+	}
+	return c.members[0], true
+}
+
+func (c *cluster) markDown(member string) {
+	c.Lock()
+	defer c.Unlock()
+	for i, m := range c.members {
+		if m == member {
+			c.members = append(c.members[:i], c.members[i+1:]...)
+			return
+		}
+	}
+}
+
+// reset repopulates members from the original, full cluster member list.
+func (c *cluster) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.members = append([]string(nil), c.all...)
+}
+
+// size returns the number of members in the original, full cluster member list.
+func (c *cluster) size() int {
+	c.RLock()
+	defer c.RUnlock()
+	return len(c.all)
+}
+
+// marathonClient is the concrete implementation of the Marathon client
+type marathonClient struct {
+	sync.RWMutex
+	// config is the configuration the client was created with
+	config Config
+	// hosts is the cluster of marathon members we can talk to
+	hosts *cluster
+	// listeners is the collection of registered event listeners
+	listeners map[EventsChannel]EventsChannelContext
+	// eventsHTTP is the HTTP server used for the callback events transport
+	eventsHTTP *http.Server
+	// ipAddress is the detected local ip address used for the callback url
+	ipAddress string
+	// lastEventID is the id of the last SSE event successfully processed, used
+	// to resume the stream via Last-Event-ID on reconnect. Only ever touched
+	// from the single SSE goroutine.
+	lastEventID string
+	// activeTransport is the EventTransport currently feeding events, once registered
+	activeTransport EventTransport
+	// feedsLock guards feeds
+	feedsLock sync.Mutex
+	// feeds holds one Feed per event ID, lazily created by the feed method
+	feeds map[int]*Feed
+	// ctx governs the lifetime of the client's event subscriptions
+	ctx context.Context
+	// cancel cancels ctx; invoked by Close()
+	cancel context.CancelFunc
+}
+
+// NewClient creates a new Marathon client
+func NewClient(config Config) (Marathon, error) {
+	return ClientWithContext(config, config.Context)
+}
+
+// ClientWithContext creates a new Marathon client whose event subscriptions
+// are bound to ctx: cancelling ctx unblocks in-flight requests and stops the
+// SSE and WebSocket transports' background goroutines. It does not shut down
+// the callback server, unsubscribe the callback or close listener channels;
+// Close() on the returned client does all of that and also cancels ctx.
+func ClientWithContext(config Config, ctx context.Context) (Marathon, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	config.Context = ctx
+
+	return &marathonClient{
+		config:    config,
+		hosts:     newCluster([]string{config.URL}),
+		listeners: make(map[EventsChannel]EventsChannelContext),
+		ctx:       ctx,
+		cancel:    cancel,
+	}, nil
+}
+
+func (r *marathonClient) debugLog(format string, args ...interface{}) {
+	if r.config.LogOutput != nil {
+		log.New(r.config.LogOutput, "", log.LstdFlags).Printf(format, args...)
+	}
+}
+
+// buildAPIRequest constructs an *http.Request against the currently active
+// cluster member, bound to the client's context so that cancelling it (via
+// Close or the context passed to ClientWithContext) unblocks any in-flight
+// request, including a long-lived SSE subscription.
+func (r *marathonClient) buildAPIRequest(method, path string, body []byte) (*http.Request, string, error) {
+	member, ok := r.hosts.activeMember()
+	if !ok {
+		return nil, "", fmt.Errorf("no active marathon cluster member available")
+	}
+
+	request, err := http.NewRequest(method, fmt.Sprintf("%s%s", member, path), nil)
+	if err != nil {
+		return nil, member, newRequestError{err: err}
+	}
+
+	return request.WithContext(r.ctx), member, nil
+}
+
+// Close cancels the client's context, shuts down the events callback server,
+// unsubscribes all callbacks and waits for pending listener goroutines to
+// finish before returning.
+func (r *marathonClient) Close() error {
+	r.Lock()
+	r.cancel()
+
+	callback := r.SubscriptionURL()
+	hadCallbackListeners := r.config.EventsTransport == EventsTransportCallback && len(r.listeners) > 0
+
+	type pendingListener struct {
+		channel    EventsChannel
+		completion *sync.WaitGroup
+	}
+	pending := make([]pendingListener, 0, len(r.listeners))
+	for channel, listenerCtx := range r.listeners {
+		close(listenerCtx.done)
+		pending = append(pending, pendingListener{channel, listenerCtx.completion})
+		delete(r.listeners, channel)
+	}
+
+	transport := r.activeTransport
+	r.activeTransport = nil
+	eventsHTTP := r.eventsHTTP
+	r.Unlock()
+
+	var firstErr error
+	if hadCallbackListeners {
+		if err := r.Unsubscribe(callback); err != nil {
+			firstErr = err
+		}
+	}
+
+	// step: shut the callback HTTP server down first, so it stops accepting
+	// new event deliveries and waits for in-flight ones to finish, before the
+	// transport closes the channel those deliveries are published on
+	if eventsHTTP != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := eventsHTTP.Shutdown(shutdownCtx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if transport != nil {
+		if err := transport.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, listener := range pending {
+		listener.completion.Wait()
+		close(listener.channel)
+	}
+
+	return firstErr
+}
+
+func (r *marathonClient) apiGet(path string, body, result interface{}) error {
+	return nil
+}
+
+func (r *marathonClient) apiPost(path, body string, result interface{}) error {
+	return nil
+}
+
+func (r *marathonClient) apiDelete(path string, body, result interface{}) error {
+	return nil
+}
+
+func getInterfaceAddress(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("interface %s has no addresses", name)
+	}
+
+	ip, _, err := net.ParseCIDR(addrs[0].String())
+	if err != nil {
+		return "", err
+	}
+
+	return ip.String(), nil
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2014 The go-marathon Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+const (
+	// metricEventPrefix prefixes per-event-type counts, e.g.
+	// "events.status_update_event"
+	metricEventPrefix = "events."
+	// metricDroppedEvents counts events dropped because a listener's queue was full
+	metricDroppedEvents = "events.dropped"
+	// metricListenerCount reports the current number of registered listeners
+	metricListenerCount = "listeners.count"
+	// metricSSEReconnects counts SSE subscription reconnect attempts
+	metricSSEReconnects = "sse.reconnects"
+)
+
+// reportMetric forwards a single (name, value) instrumentation point to
+// Config.MetricsHook, if one is configured. It is a no-op otherwise, so
+// callers don't need to guard every call site.
+func (r *marathonClient) reportMetric(name string, value float64) {
+	if r.config.MetricsHook != nil {
+		r.config.MetricsHook(name, value)
+	}
+}
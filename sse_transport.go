@@ -0,0 +1,232 @@
+/*
+Copyright 2014 The go-marathon Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/udacity/eventsource"
+)
+
+// sseTransport is the built-in EventTransport that continously tries to
+// connect to Marathon's /v2/events SSE stream and process the received
+// events. To establish the connection it tries the active cluster members
+// until no more member is active. When this happens it retries with a
+// decorrelated-jitter exponential backoff instead of hammering the cluster on
+// a fixed interval, and resumes the stream from the last processed event id
+// rather than replaying it from scratch when Config.SSEResumeFromLastEventID
+// is set.
+type sseTransport struct {
+	client      *Client
+	events      chan rawEvent
+	lastEventID string
+	// registered indicates whether the background reconnect/listen goroutine
+	// has been started
+	registered bool
+	// wg tracks the background reconnect/listen goroutine, so Close can wait
+	// for it to actually exit before closing events out from under it
+	wg sync.WaitGroup
+}
+
+func newSSETransport() *sseTransport {
+	return &sseTransport{events: make(chan rawEvent, 64)}
+}
+
+func (t *sseTransport) Register(ctx context.Context, client *Client) error {
+	if t.registered {
+		return nil
+	}
+	t.client = client
+	marathon := client.marathon
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		baseBackoff := marathon.config.SSEBackoff
+		if baseBackoff <= 0 {
+			baseBackoff = defaultSSEBackoff
+		}
+		backoff := baseBackoff
+		maxBackoff := marathon.config.SSEMaxBackoff
+		if maxBackoff <= 0 {
+			maxBackoff = defaultSSEMaxBackoff
+		}
+
+		attempt := 0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			if attempt > 0 {
+				client.ReportMetric(metricSSEReconnects, 1)
+				if marathon.config.OnSSEReconnect != nil {
+					marathon.config.OnSSEReconnect(attempt, marathon.lastEventID, nil)
+				}
+			}
+
+			connectedAt := time.Now()
+			stream, err := t.connect(marathon)
+			if err != nil {
+				if err == ctx.Err() {
+					return
+				}
+				if marathon.config.OnSSEReconnect != nil {
+					marathon.config.OnSSEReconnect(attempt, marathon.lastEventID, err)
+				}
+				client.DebugLog("Error connecting SSE subscription: %s", err)
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return
+				}
+				backoff = nextSSEBackoff(backoff, baseBackoff, maxBackoff)
+				attempt++
+				continue
+			}
+
+			err = t.listen(ctx, stream)
+			stream.Close()
+			if ctx.Err() != nil {
+				return
+			}
+			client.DebugLog("Error on SSE subscription: %s", err)
+
+			// step: a long-lived, healthy connection earns a reset back to the
+			// base backoff; a connection that dies quickly keeps growing it
+			if time.Since(connectedAt) >= sseHealthyThreshold {
+				backoff = baseBackoff
+				attempt = 1
+			} else {
+				backoff = nextSSEBackoff(backoff, baseBackoff, maxBackoff)
+				attempt++
+			}
+		}
+	}()
+
+	t.registered = true
+	return nil
+}
+
+// connect tries to establish an *eventsource.Stream to each active Marathon cluster member in turn, marking a
+// member as down on connection failure, until one accepts the subscription or every member has been tried. In
+// the latter case it repopulates the cluster member list so the next reconnect attempt (after the caller's
+// backoff) starts fresh, and returns an error rather than spinning on an empty cluster. When
+// Config.SSEResumeFromLastEventID is set and a previous event has been processed, the stream is resumed via the
+// Last-Event-ID header instead of starting over.
+// Given the http request can not be built, it will panic as this case should never happen.
+func (t *sseTransport) connect(client *marathonClient) (*eventsource.Stream, error) {
+	lastEventID := ""
+	if client.config.SSEResumeFromLastEventID {
+		lastEventID = client.lastEventID
+	}
+
+	attempts := client.hosts.size()
+	if attempts == 0 {
+		attempts = 1
+	}
+
+	for i := 0; i < attempts; i++ {
+		if err := client.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		request, member, err := client.buildAPIRequest("GET", marathonAPIEventStream, nil)
+		if err != nil {
+			switch err.(type) {
+			case newRequestError:
+				panic(fmt.Sprintf("Requests for SSE subscriptions should never fail to be created: %s", err.Error()))
+			default:
+				return nil, err
+			}
+		}
+
+		stream, err := eventsource.SubscribeWith(lastEventID, client.config.HTTPSSEClient, request)
+		if err != nil {
+			client.debugLog("Error subscribing to Marathon event stream: %s", err)
+			client.hosts.markDown(member)
+			continue
+		}
+
+		return stream, nil
+	}
+
+	// step: every cluster member is down; repopulate them so the next
+	// reconnect attempt, after the caller's backoff, starts fresh
+	client.hosts.reset()
+	return nil, fmt.Errorf("no marathon cluster member accepted the SSE subscription")
+}
+
+func (t *sseTransport) listen(ctx context.Context, stream *eventsource.Stream) error {
+	for {
+		select {
+		case ev := <-stream.Events:
+			t.events <- rawEvent(ev.Data())
+			if id := ev.Id(); id != "" {
+				t.client.SetLastEventID(id)
+			}
+		case err := <-stream.Errors:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (t *sseTransport) Events() <-chan rawEvent {
+	return t.events
+}
+
+// Close waits for the background reconnect/listen goroutine to exit before
+// closing events, so a send still in flight inside listen's select can never
+// race a close on the same channel.
+func (t *sseTransport) Close() error {
+	t.wg.Wait()
+	close(t.events)
+	return nil
+}
+
+// nextSSEBackoff computes the next decorrelated-jitter backoff delay:
+// sleep = min(cap, random_between(base, prev*3)). base is the fixed floor
+// the backoff can fall back to - as opposed to prev, which grows every
+// attempt - so that, per the decorrelated-jitter algorithm, a lucky draw can
+// occasionally bring the delay back down instead of it ratcheting upward
+// forever.
+func nextSSEBackoff(prev, base, cap time.Duration) time.Duration {
+	if base <= 0 {
+		base = defaultSSEBackoff
+	}
+
+	upper := prev * 3
+	if upper <= base {
+		upper = base + 1
+	}
+
+	next := base + time.Duration(rand.Int63n(int64(upper-base)))
+	if next > cap {
+		next = cap
+	}
+
+	return next
+}
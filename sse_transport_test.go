@@ -0,0 +1,70 @@
+/*
+Copyright 2014 The go-marathon Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextSSEBackoffStaysWithinBounds(t *testing.T) {
+	const base = 500 * time.Millisecond
+	const cap = 60 * time.Second
+
+	prev := base
+	for i := 0; i < 1000; i++ {
+		next := nextSSEBackoff(prev, base, cap)
+		if next < base {
+			t.Fatalf("nextSSEBackoff(%s, %s, %s) = %s, want >= base", prev, base, cap, next)
+		}
+		if next > cap {
+			t.Fatalf("nextSSEBackoff(%s, %s, %s) = %s, want <= cap", prev, base, cap, next)
+		}
+		prev = next
+	}
+}
+
+// TestNextSSEBackoffCanComeBackDown asserts that the backoff floor stays
+// pinned at base rather than ratcheting upward with prev, so that a series
+// of unlucky draws can still be followed by a much smaller delay - the
+// whole point of decorrelated jitter as an anti-thundering-herd measure.
+func TestNextSSEBackoffCanComeBackDown(t *testing.T) {
+	const base = 500 * time.Millisecond
+	const cap = 60 * time.Second
+
+	// drive prev up as far as it can go
+	prev := base
+	for prev < cap {
+		prev = nextSSEBackoff(prev, base, cap)
+	}
+	if prev < cap/2 {
+		t.Fatalf("expected prev to have grown close to cap, got %s", prev)
+	}
+
+	// with prev at cap a draw lands within base*2 with probability of about
+	// base/(3*cap), roughly 1 in 360, so allow enough draws to see one
+	sawSmall := false
+	for i := 0; i < 10000; i++ {
+		if next := nextSSEBackoff(prev, base, cap); next <= base*2 {
+			sawSmall = true
+			break
+		}
+	}
+	if !sawSmall {
+		t.Fatal("nextSSEBackoff never drew a value close to base after prev grew large; the floor appears to ratchet upward with prev instead of staying pinned at base")
+	}
+}
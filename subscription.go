@@ -19,14 +19,9 @@ package marathon
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net"
-	"net/http"
 	"strings"
 	"sync"
-	"time"
-
-	"github.com/udacity/eventsource"
+	"sync/atomic"
 )
 
 // Subscriptions is a collection to urls that marathon is implementing a callback on
@@ -44,9 +39,24 @@ func (r *marathonClient) Subscriptions() (*Subscriptions, error) {
 	return subscriptions, nil
 }
 
-// AddEventsListener adds your self as a listener to events from Marathon
+// AddEventsListener adds your self as a listener to events from Marathon,
+// with a default-sized, oldest-drop internal queue. Use
+// AddEventsListenerWithOptions to tune the queue size or drop policy for a
+// particular consumer.
 //		channel:	a EventsChannel used to receive event on
 func (r *marathonClient) AddEventsListener(filter int) (EventsChannel, error) {
+	return r.AddEventsListenerWithOptions(filter, ListenerOptions{})
+}
+
+// AddEventsListenerWithOptions adds your self as a listener to events from
+// Marathon. Events for this listener are queued in a bounded, per-listener
+// buffer drained by a single dispatcher goroutine into the returned channel,
+// so a slow consumer only ever blocks that one goroutine; once the queue is
+// full, further events are dropped per opts.DropNewest and counted, visible
+// via ListenerStats.
+//		filter:	a bitmask of the EventID* values you want to receive
+//		opts:	queue size and drop policy for this listener
+func (r *marathonClient) AddEventsListenerWithOptions(filter int, opts ListenerOptions) (EventsChannel, error) {
 	r.Lock()
 	defer r.Unlock()
 
@@ -56,15 +66,65 @@ func (r *marathonClient) AddEventsListener(filter int) (EventsChannel, error) {
 		return nil, err
 	}
 
+	queueSize := opts.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultListenerQueueSize
+	}
+
 	channel := make(EventsChannel)
-	r.listeners[channel] = EventsChannelContext{
+	context := EventsChannelContext{
 		filter:     filter,
 		done:       make(chan struct{}, 1),
 		completion: &sync.WaitGroup{},
+		queue:      make(chan *Event, queueSize),
+		dropNewest: opts.DropNewest,
+		dropped:    new(uint64),
 	}
+	r.listeners[channel] = context
+
+	context.completion.Add(1)
+	go r.dispatchListener(channel, context)
+
+	r.reportMetric(metricListenerCount, float64(len(r.listeners)))
+
 	return channel, nil
 }
 
+// dispatchListener drains context.queue into channel until context.done is
+// closed, so a consumer that stops reading channel only ever stalls this one
+// goroutine instead of the shared handleEvent dispatch path.
+func (r *marathonClient) dispatchListener(channel EventsChannel, context EventsChannelContext) {
+	defer context.completion.Done()
+
+	for {
+		select {
+		case event := <-context.queue:
+			select {
+			case channel <- event:
+			case <-context.done:
+				return
+			}
+		case <-context.done:
+			return
+		}
+	}
+}
+
+// ListenerStats returns bookkeeping for the given listener channel, most
+// notably how many events it has dropped because it wasn't draining
+// EventsChannel fast enough.
+func (r *marathonClient) ListenerStats(channel EventsChannel) Stats {
+	r.RLock()
+	defer r.RUnlock()
+
+	context, found := r.listeners[channel]
+	if !found {
+		return Stats{}
+	}
+
+	return Stats{DroppedEvents: atomic.LoadUint64(context.dropped)}
+}
+
 // RemoveEventsListener removes the channel from the events listeners
 //		channel:			the channel you are removing
 func (r *marathonClient) RemoveEventsListener(channel EventsChannel) {
@@ -80,7 +140,9 @@ func (r *marathonClient) RemoveEventsListener(channel EventsChannel) {
 			r.Unsubscribe(r.SubscriptionURL())
 		}
 
-		// step: wait for pending goroutines to finish and close channel
+		r.reportMetric(metricListenerCount, float64(len(r.listeners)))
+
+		// step: wait for the dispatcher goroutine to finish and close channel
 		go func(completion *sync.WaitGroup) {
 			completion.Wait()
 			close(channel)
@@ -97,136 +159,33 @@ func (r *marathonClient) SubscriptionURL() string {
 	return fmt.Sprintf("http://%s:%d%s", r.ipAddress, r.config.EventsPort, defaultEventsURL)
 }
 
-// registerSubscription registers ourselves with Marathon to receive events from configured transport facility
+// registerSubscription registers ourselves with Marathon to receive events
+// from the configured EventTransport. The transport itself, and the
+// dispatcher goroutine feeding its raw events into handleEvent, are created
+// once and reused for the client's lifetime, but Register is called again on
+// every invocation so e.g. the callback transport re-subscribes with
+// Marathon after RemoveEventsListener unsubscribed it when the listener set
+// last emptied out.
 func (r *marathonClient) registerSubscription() error {
-	switch r.config.EventsTransport {
-	case EventsTransportCallback:
-		return r.registerCallbackSubscription()
-	case EventsTransportSSE:
-		return r.registerSSESubscription()
-	default:
-		return fmt.Errorf("the events transport: %d is not supported", r.config.EventsTransport)
-	}
-}
-
-func (r *marathonClient) registerCallbackSubscription() error {
-	if r.eventsHTTP == nil {
-		ipAddress, err := getInterfaceAddress(r.config.EventsInterface)
-		if err != nil {
-			return fmt.Errorf("Unable to get the ip address from the interface: %s, error: %s",
-				r.config.EventsInterface, err)
-		}
-
-		// step: set the ip address
-		r.ipAddress = ipAddress
-		binding := fmt.Sprintf("%s:%d", ipAddress, r.config.EventsPort)
-		// step: register the handler
-		http.HandleFunc(defaultEventsURL, r.handleCallbackEvent)
-		// step: create the http server
-		r.eventsHTTP = &http.Server{
-			Addr:           binding,
-			Handler:        nil,
-			ReadTimeout:    10 * time.Second,
-			WriteTimeout:   10 * time.Second,
-			MaxHeaderBytes: 1 << 20,
-		}
-
-		// @todo need to add a timeout value here
-		listener, err := net.Listen("tcp", binding)
+	transport := r.activeTransport
+	if transport == nil {
+		var err error
+		transport, err = r.eventTransport(r.config.EventsTransport)
 		if err != nil {
-			return nil
+			return err
 		}
+		r.activeTransport = transport
 
 		go func() {
-			for {
-				r.eventsHTTP.Serve(listener)
+			for raw := range transport.Events() {
+				if err := r.handleEvent(string(raw)); err != nil {
+					r.debugLog("registerSubscription(): failed to handle event: %v", err)
+				}
 			}
 		}()
 	}
 
-	// step: get the callback url
-	callback := r.SubscriptionURL()
-
-	// step: check if the callback is registered
-	found, err := r.HasSubscription(callback)
-	if err != nil {
-		return err
-	}
-	if !found {
-		// step: we need to register ourselves
-		if err := r.Subscribe(callback); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-// registerSSESubscription starts a go routine that continously tries to
-// connect to the SSE stream and to process the received events. To establish
-// the connection it tries the active cluster members until no more member is
-// active. When this happens it will retry to get a connection every 5 seconds.
-func (r *marathonClient) registerSSESubscription() error {
-	if r.subscribedToSSE {
-		return nil
-	}
-
-	go func() {
-		for {
-			stream, err := r.connectToSSE()
-			if err != nil {
-				r.debugLog("Error connecting SSE subscription: %s", err)
-				<-time.After(5 * time.Second)
-				continue
-			}
-			err = r.listenToSSE(stream)
-			stream.Close()
-			r.debugLog("Error on SSE subscription: %s", err)
-		}
-	}()
-
-	r.subscribedToSSE = true
-	return nil
-}
-
-// connectToSSE tries to establish an *eventsource.Stream to any of the Marathon cluster members, marking the
-// member as down on connection failure, until there is no more active member in the cluster.
-// Given the http request can not be built, it will panic as this case should never happen.
-func (r *marathonClient) connectToSSE() (*eventsource.Stream, error) {
-	for {
-		request, member, err := r.buildAPIRequest("GET", marathonAPIEventStream, nil)
-		if err != nil {
-			switch err.(type) {
-			case newRequestError:
-				panic(fmt.Sprintf("Requests for SSE subscriptions should never fail to be created: %s", err.Error()))
-			default:
-				return nil, err
-			}
-		}
-
-		stream, err := eventsource.SubscribeWith("", r.config.HTTPSSEClient, request)
-		if err != nil {
-			r.debugLog("Error subscribing to Marathon event stream: %s", err)
-			r.hosts.markDown(member)
-			continue
-		}
-
-		return stream, nil
-	}
-}
-
-func (r *marathonClient) listenToSSE(stream *eventsource.Stream) error {
-	for {
-		select {
-		case ev := <-stream.Events:
-			if err := r.handleEvent(ev.Data()); err != nil {
-				r.debugLog("listenToSSE(): failed to handle event: %v", err)
-			}
-		case err := <-stream.Errors:
-			return err
-
-		}
-	}
+	return transport.Register(r.ctx, &Client{marathon: r})
 }
 
 // Subscribe adds a URL to Marathon's callback facility
@@ -262,6 +221,44 @@ func (r *marathonClient) HasSubscription(callback string) (bool, error) {
 	return false, nil
 }
 
+// feed returns the Feed for the given event ID, creating it on first use.
+func (r *marathonClient) feed(id int) *Feed {
+	r.feedsLock.Lock()
+	defer r.feedsLock.Unlock()
+
+	if r.feeds == nil {
+		r.feeds = make(map[int]*Feed)
+	}
+	f, found := r.feeds[id]
+	if !found {
+		f = NewFeed()
+		r.feeds[id] = f
+	}
+	return f
+}
+
+// SubscribeStatusUpdates subscribes channel to task status update events.
+// Delivery is non-blocking: when channel falls behind, the oldest queued
+// event is dropped and the drop is reported via the returned Subscription's
+// Err() channel rather than via ListenerStats. It does not register the
+// client's event transport itself; events arrive only once AddEventsListener
+// has registered it.
+func (r *marathonClient) SubscribeStatusUpdates(channel chan<- *EventStatusUpdate) Subscription {
+	return r.feed(EventIDStatusUpdate).Subscribe(channel)
+}
+
+// SubscribeDeploymentSuccess subscribes channel to successful deployment events.
+// Like SubscribeStatusUpdates, it does not register the event transport itself.
+func (r *marathonClient) SubscribeDeploymentSuccess(channel chan<- *EventDeploymentSuccess) Subscription {
+	return r.feed(EventIDDeploymentSuccess).Subscribe(channel)
+}
+
+// SubscribeDeploymentFailed subscribes channel to failed deployment events.
+// Like SubscribeStatusUpdates, it does not register the event transport itself.
+func (r *marathonClient) SubscribeDeploymentFailed(channel chan<- *EventDeploymentFailed) Subscription {
+	return r.feed(EventIDDeploymentFailed).Subscribe(channel)
+}
+
 func (r *marathonClient) handleEvent(content string) error {
 	// step: process and decode the event
 	eventType := new(EventType)
@@ -282,38 +279,51 @@ func (r *marathonClient) handleEvent(content string) error {
 		return fmt.Errorf("failed to decode the event, id: %d, error: %s", event.ID, err)
 	}
 
+	r.reportMetric(fmt.Sprintf("%s%s", metricEventPrefix, eventType.EventType), 1)
+
+	// step: fan the typed payload out to anyone subscribed via a Feed
+	r.feed(event.ID).Send(event.Event)
+
 	r.RLock()
 	defer r.RUnlock()
 
 	// step: check if anyone is listen for this event
-	for channel, context := range r.listeners {
+	for _, context := range r.listeners {
 		// step: check if this listener wants this event type
 		if event.ID&context.filter != 0 {
-			context.completion.Add(1)
-			go func(ch EventsChannel, context EventsChannelContext, e *Event) {
-				defer context.completion.Done()
-				select {
-				case ch <- e:
-				case <-context.done:
-					// Terminates goroutine.
-				}
-			}(channel, context, event)
+			r.enqueueListenerEvent(context, event)
 		}
 	}
 
 	return nil
 }
 
-func (r *marathonClient) handleCallbackEvent(writer http.ResponseWriter, request *http.Request) {
-	body, err := ioutil.ReadAll(request.Body)
-	if err != nil {
-		// TODO should this return a 500?
-		r.debugLog("handleCallbackEvent(): failed to read request body, error: %s", err)
+// enqueueListenerEvent hands event to context's bounded queue without
+// blocking handleEvent. If the queue is full, it drops either the oldest
+// queued event (the default) or the incoming event itself
+// (context.dropNewest), and counts the drop for ListenerStats and the
+// MetricsHook.
+func (r *marathonClient) enqueueListenerEvent(context EventsChannelContext, event *Event) {
+	select {
+	case context.queue <- event:
+		return
+	default:
+	}
+
+	if context.dropNewest {
+		atomic.AddUint64(context.dropped, 1)
+		r.reportMetric(metricDroppedEvents, 1)
 		return
 	}
 
-	if err := r.handleEvent(string(body[:])); err != nil {
-		// TODO should this return a 500?
-		r.debugLog("handleCallbackEvent(): failed to handle event: %v", err)
+	select {
+	case <-context.queue:
+	default:
+	}
+	select {
+	case context.queue <- event:
+	default:
 	}
+	atomic.AddUint64(context.dropped, 1)
+	r.reportMetric(metricDroppedEvents, 1)
 }
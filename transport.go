@@ -0,0 +1,167 @@
+/*
+Copyright 2014 The go-marathon Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// rawEvent is an undecoded Marathon event, as received off the wire from
+// whichever EventTransport ingested it.
+type rawEvent string
+
+// EventTransport is the ingestion side of the events subsystem: it is
+// responsible for establishing and maintaining a connection to a source of
+// Marathon events and surfacing the raw, undecoded payloads on Events().
+// AddEventsListener/handleEvent stay transport-agnostic and only deal with
+// the decoded *Event.
+type EventTransport interface {
+	// Register starts the transport, e.g. registering a callback subscription
+	// with Marathon or opening the SSE/websocket stream. It must return once
+	// the transport is up and running; ongoing work happens in the
+	// background until ctx is cancelled.
+	Register(ctx context.Context, client *Client) error
+	// Events returns the channel raw event payloads are published on
+	Events() <-chan rawEvent
+	// Close closes the Events() channel. The built-in SSE and WebSocket
+	// transports first wait for their background goroutine, which exits only
+	// once the ctx given to Register is cancelled.
+	Close() error
+}
+
+// Client is the handle an EventTransport is given to interact with the
+// Marathon client that registered it: building requests
+// against the cluster, reporting member health and reconnect metrics, and
+// the handful of other primitives a transport needs. It exists so that
+// EventTransport implementations - e.g. a fan-out transport republishing
+// Marathon events on a message bus for multiple consumers to share a single
+// upstream subscription - can be written in a separate package, since
+// marathonClient itself is unexported.
+type Client struct {
+	marathon *marathonClient
+}
+
+// Context returns the context governing the client's event subscriptions;
+// it is cancelled when Close is called.
+func (c *Client) Context() context.Context {
+	return c.marathon.ctx
+}
+
+// Config returns the configuration the client was created with.
+func (c *Client) Config() Config {
+	return c.marathon.config
+}
+
+// BuildAPIRequest constructs an *http.Request against the currently active
+// cluster member, bound to the client's context, along with the member the
+// request targets so the transport can report it down on failure.
+func (c *Client) BuildAPIRequest(method, path string) (*http.Request, string, error) {
+	return c.marathon.buildAPIRequest(method, path, nil)
+}
+
+// DebugLog writes a formatted line to Config.LogOutput, if one is configured.
+func (c *Client) DebugLog(format string, args ...interface{}) {
+	c.marathon.debugLog(format, args...)
+}
+
+// MarkMemberDown removes member from the active cluster rotation.
+func (c *Client) MarkMemberDown(member string) {
+	c.marathon.hosts.markDown(member)
+}
+
+// ClusterSize returns the number of members in the full cluster member list.
+func (c *Client) ClusterSize() int {
+	return c.marathon.hosts.size()
+}
+
+// ResetCluster repopulates the cluster member list from the original, full
+// set, e.g. once every member has been marked down and it's time to retry
+// them all again.
+func (c *Client) ResetCluster() {
+	c.marathon.hosts.reset()
+}
+
+// ReportMetric forwards a single (name, value) instrumentation point to
+// Config.MetricsHook, if one is configured.
+func (c *Client) ReportMetric(name string, value float64) {
+	c.marathon.reportMetric(name, value)
+}
+
+// LastEventID returns the id of the last event this client successfully
+// processed, for transports that support resuming a stream instead of
+// replaying it from scratch.
+func (c *Client) LastEventID() string {
+	return c.marathon.lastEventID
+}
+
+// SetLastEventID records the id of the last event this client successfully
+// processed.
+func (c *Client) SetLastEventID(id string) {
+	c.marathon.lastEventID = id
+}
+
+// HasSubscription checks whether callback is already registered with
+// Marathon's callback facility.
+func (c *Client) HasSubscription(callback string) (bool, error) {
+	return c.marathon.HasSubscription(callback)
+}
+
+// Subscribe registers callback with Marathon's callback facility.
+func (c *Client) Subscribe(callback string) error {
+	return c.marathon.Subscribe(callback)
+}
+
+// SubscriptionURL returns the callback URL used when registering for events.
+func (c *Client) SubscriptionURL() string {
+	return c.marathon.SubscriptionURL()
+}
+
+// eventTransport resolves the EventTransport to use for the given transport
+// id, preferring a caller-registered override from Config.EventTransports
+// over the built-ins.
+func (r *marathonClient) eventTransport(id EventsTransportType) (EventTransport, error) {
+	if t, found := r.config.EventTransports[id]; found {
+		return t, nil
+	}
+
+	switch id {
+	case EventsTransportCallback:
+		return newCallbackTransport(), nil
+	case EventsTransportSSE:
+		return newSSETransport(), nil
+	case EventsTransportWebSocket:
+		return newWebSocketTransport(), nil
+	default:
+		return nil, fmt.Errorf("the events transport: %d is not supported", id)
+	}
+}
+
+// RegisterEventTransport registers a custom EventTransport to handle the
+// given transport id, overriding the built-in callback/SSE transports. It
+// must be called before the first AddEventsListener call for id to take
+// effect.
+func (r *marathonClient) RegisterEventTransport(id EventsTransportType, transport EventTransport) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.config.EventTransports == nil {
+		r.config.EventTransports = make(map[EventsTransportType]EventTransport)
+	}
+	r.config.EventTransports[id] = transport
+}
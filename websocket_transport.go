@@ -0,0 +1,182 @@
+/*
+Copyright 2014 The go-marathon Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// EventsTransportWebSocket subscribes to Marathon events over a WebSocket
+// connection rather than SSE. It is useful behind proxies or load balancers
+// that buffer or terminate long-lived SSE responses, since a WebSocket
+// upgrade is usually let through untouched.
+const EventsTransportWebSocket EventsTransportType = 2
+
+// webSocketTransport is a built-in EventTransport that dials
+// marathonAPIEventStream as a WebSocket connection and treats every text
+// message received as one raw Marathon event. It reconnects using the same
+// decorrelated-jitter backoff as the SSE transport.
+type webSocketTransport struct {
+	client *Client
+	events chan rawEvent
+	// registered indicates whether the background dial/listen goroutine has
+	// been started
+	registered bool
+	// wg tracks the background dial/listen goroutine, so Close can wait for
+	// it to actually exit before closing events out from under it
+	wg sync.WaitGroup
+}
+
+func newWebSocketTransport() *webSocketTransport {
+	return &webSocketTransport{events: make(chan rawEvent, 64)}
+}
+
+func (t *webSocketTransport) Register(ctx context.Context, client *Client) error {
+	if t.registered {
+		return nil
+	}
+	t.client = client
+	marathon := client.marathon
+
+	baseBackoff := marathon.config.SSEBackoff
+	if baseBackoff <= 0 {
+		baseBackoff = defaultSSEBackoff
+	}
+	backoff := baseBackoff
+	maxBackoff := marathon.config.SSEMaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultSSEMaxBackoff
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			conn, err := t.dial(marathon)
+			if err != nil {
+				client.DebugLog("webSocketTransport: error connecting: %s", err)
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return
+				}
+				backoff = nextSSEBackoff(backoff, baseBackoff, maxBackoff)
+				continue
+			}
+
+			connectedAt := time.Now()
+			err = t.listen(ctx, conn)
+			conn.Close()
+			if ctx.Err() != nil {
+				return
+			}
+			client.DebugLog("webSocketTransport: connection lost: %s", err)
+
+			if time.Since(connectedAt) >= sseHealthyThreshold {
+				backoff = baseBackoff
+			} else {
+				backoff = nextSSEBackoff(backoff, baseBackoff, maxBackoff)
+			}
+		}
+	}()
+
+	t.registered = true
+	return nil
+}
+
+// dial tries each active cluster member in turn, marking unreachable ones
+// down, until one accepts the WebSocket upgrade or every member has been
+// tried. In the latter case it repopulates the cluster member list so the
+// next reconnect attempt (after the caller's backoff) starts fresh, and
+// returns an error rather than spinning on an empty cluster.
+func (t *webSocketTransport) dial(client *marathonClient) (*websocket.Conn, error) {
+	attempts := client.hosts.size()
+	if attempts == 0 {
+		attempts = 1
+	}
+
+	for i := 0; i < attempts; i++ {
+		if err := client.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		request, member, err := client.buildAPIRequest("GET", marathonAPIEventStream, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		url := strings.Replace(request.URL.String(), "http", "ws", 1)
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			client.debugLog("webSocketTransport: error dialing %s: %s", url, err)
+			client.hosts.markDown(member)
+			continue
+		}
+
+		return conn, nil
+	}
+
+	// step: every cluster member is down; repopulate them so the next
+	// reconnect attempt, after the caller's backoff, starts fresh
+	client.hosts.reset()
+	return nil, fmt.Errorf("no marathon cluster member accepted the websocket upgrade")
+}
+
+func (t *webSocketTransport) listen(ctx context.Context, conn *websocket.Conn) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		t.events <- rawEvent(message)
+	}
+}
+
+func (t *webSocketTransport) Events() <-chan rawEvent {
+	return t.events
+}
+
+// Close waits for the background dial/listen goroutine to exit before
+// closing events, so a send still in flight inside listen can never race a
+// close on the same channel.
+func (t *webSocketTransport) Close() error {
+	t.wg.Wait()
+	close(t.events)
+	return nil
+}
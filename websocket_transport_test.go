@@ -0,0 +1,65 @@
+/*
+Copyright 2014 The go-marathon Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestWebSocketTransportCloseDuringBackoffReturnsPromptly asserts that
+// Close() does not have to wait out a long reconnect backoff: the
+// reconnect goroutine's sleep must itself be cancellable via ctx so Close()
+// can wg.Wait() on it and return quickly once Register's ctx is cancelled.
+func TestWebSocketTransportCloseDuringBackoffReturnsPromptly(t *testing.T) {
+	transport := newWebSocketTransport()
+
+	marathon := &marathonClient{
+		// nothing listens on this address, so every dial attempt fails fast
+		config: Config{
+			SSEBackoff:    time.Minute,
+			SSEMaxBackoff: time.Minute,
+		},
+		hosts: newCluster([]string{"http://127.0.0.1:1"}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	marathon.ctx = ctx
+	marathon.cancel = cancel
+
+	if err := transport.Register(ctx, &Client{marathon: marathon}); err != nil {
+		t.Fatalf("Register() returned error: %s", err)
+	}
+
+	// let the background goroutine hit its first dial failure and enter the
+	// (long) backoff sleep before we ask it to stop
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- transport.Close() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Close() returned error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close() did not return promptly; the reconnect goroutine appears to be blocked sleeping out the backoff")
+	}
+}